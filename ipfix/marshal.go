@@ -27,14 +27,60 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net"
 	"strconv"
+	"time"
 )
 
 var errUknownMarshalDataType = errors.New("unknown data type to marshal")
 
-// JSONMarshal encodes IPFIX message
-func (m *Message) JSONMarshal(b *bytes.Buffer, datasetIndex int) ([]byte, error) {
+// MarshalOptions controls how JSONMarshal renders a decoded data set.
+// The zero value reproduces the original numeric-keyed, untyped output
+// so existing callers and downstream consumers keep working unchanged.
+type MarshalOptions struct {
+	// NamedFields keys each field by its canonical InfoModel name
+	// (e.g. "protocolIdentifier") instead of "<enterpriseNo>_<elementID>".
+	// Enterprise elements are prefixed with their vendor name when known,
+	// e.g. "cisco:applicationId". Fields with no InfoModel entry fall
+	// back to the numeric key.
+	NamedFields bool
+
+	// Semantics renders known enum-like and semantic fields symbolically:
+	// protocolIdentifier as "TCP"/"UDP", dateTimeMilliseconds fields as
+	// RFC3339 timestamps, and tcpControlBits/flowEndReason as their named
+	// values. Requires NamedFields so consumers can tell which fields
+	// were translated.
+	Semantics bool
+}
+
+// vendorNames maps well-known IANA Private Enterprise Numbers to the
+// short prefix used for NamedFields output, e.g. "cisco:applicationId".
+var vendorNames = map[uint32]string{
+	9:     "cisco",
+	2636:  "juniper",
+	25461: "paloalto",
+}
+
+// vendorPrefix returns the NamedFields prefix for an enterprise number:
+// its short vendor name when known, otherwise "pen<enterpriseNo>" so the
+// field still can't collide with an IANA field of the same name.
+func vendorPrefix(enterpriseNo uint32) string {
+	if vendor, ok := vendorNames[enterpriseNo]; ok {
+		return vendor
+	}
+	return "pen" + strconv.FormatUint(uint64(enterpriseNo), 10)
+}
+
+// JSONMarshal encodes IPFIX message. opts is variadic so existing call
+// sites that only pass datasetIndex keep compiling and keep producing
+// the original numeric-keyed output.
+func (m *Message) JSONMarshal(b *bytes.Buffer, datasetIndex int, opts ...MarshalOptions) ([]byte, error) {
+	var o MarshalOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
 	b.WriteString("{")
 
 	// encode agent id
@@ -44,7 +90,7 @@ func (m *Message) JSONMarshal(b *bytes.Buffer, datasetIndex int) ([]byte, error)
 	m.encodeHeader(b)
 
 	// encode data set
-	if err := m.encodeDataSet(b, datasetIndex); err != nil {
+	if err := m.encodeDataSet(b, datasetIndex, o); err != nil {
 		return nil, err
 	}
 
@@ -53,7 +99,7 @@ func (m *Message) JSONMarshal(b *bytes.Buffer, datasetIndex int) ([]byte, error)
 	return b.Bytes(), nil
 }
 
-func (m *Message) encodeDataSet(b *bytes.Buffer, i int) error {
+func (m *Message) encodeDataSet(b *bytes.Buffer, i int, opts MarshalOptions) error {
 	var (
 		num_fields int
 		num_repeats int
@@ -61,15 +107,7 @@ func (m *Message) encodeDataSet(b *bytes.Buffer, i int) error {
 		err error
 	)
 
-	data_set := m.DataSets[i]
-
-	// This is a hack for the purple project to remove icmptype and icmpcode when ipprotocol != 1
-	ip_protocol, ok := data_set[ElementKey{EnterpriseNo: 0, ElementID: 4}]
-	if !ok || ip_protocol[0].Value.(uint8) != 1 {
-		delete(data_set, ElementKey{EnterpriseNo: 0, ElementID: 176})
-		delete(data_set, ElementKey{EnterpriseNo: 0, ElementID: 177})
-	}
-	// End hack
+	data_set, renameOverrides := runTransforms(m.Header.DomainID, m.DataSets[i])
 
 	num_fields = len(data_set)
 	counter = 0
@@ -79,18 +117,11 @@ func (m *Message) encodeDataSet(b *bytes.Buffer, i int) error {
 		counter++
 
 		b.WriteByte('"')
-		b.WriteString(strconv.FormatInt(int64(eKey.EnterpriseNo), 10))
-		b.WriteByte('_')
-		b.WriteString(strconv.FormatInt(int64(eKey.ElementID), 10))
-		if eKey.MultiTypeID != 0 {
-			// Specify that this value is not the default type for its multi-type field
-			b.WriteByte('_')
-			b.WriteString(strconv.FormatInt(int64(eKey.MultiTypeID), 10))
-		}
+		b.WriteString(fieldKey(eKey, opts, renameOverrides))
 		b.WriteString("\":")
 
 		if num_repeats == 1 {
-			err = m.writeValue(b, fields[0].Value)
+			err = m.writeField(b, eKey, fields[0].Value, opts)
 		} else {
 
 			var filtered_values []interface{}
@@ -106,14 +137,14 @@ func (m *Message) encodeDataSet(b *bytes.Buffer, i int) error {
 			b.WriteByte('[')
 			for j, val := range filtered_values {
 
-				err = m.writeValue(b, val)
+				err = m.writeField(b, eKey, val, opts)
 				if j < num_repeats - 1 {
 					b.WriteByte(',')
 				}
 			}
 			b.WriteByte(']')
 		}
-		
+
 
 		if counter < num_fields {
 			b.WriteByte(',')
@@ -124,6 +155,151 @@ func (m *Message) encodeDataSet(b *bytes.Buffer, i int) error {
 	return err
 }
 
+// fieldKey returns the JSON object key for eKey: the original numeric
+// "<enterpriseNo>_<elementID>[_<multiTypeID>]" form, or the canonical
+// InfoModel name when opts.NamedFields is set and the element is known.
+// renameOverrides, if non-nil, is consulted first - it holds this
+// message's "rename" transform results, scoped to the call that produced
+// it rather than stored in InfoModel (see runTransforms).
+func fieldKey(eKey ElementKey, opts MarshalOptions, renameOverrides map[ElementKey]string) string {
+	if opts.NamedFields {
+		key := ElementKey{EnterpriseNo: eKey.EnterpriseNo, ElementID: eKey.ElementID}
+
+		if name, ok := renameOverrides[key]; ok {
+			if eKey.EnterpriseNo == 0 {
+				return name
+			}
+			return vendorPrefix(eKey.EnterpriseNo) + ":" + name
+		}
+
+		if entry, ok := lookupInfoElement(key); ok {
+			if eKey.EnterpriseNo == 0 {
+				return entry.Name
+			}
+			return vendorPrefix(eKey.EnterpriseNo) + ":" + entry.Name
+		}
+	}
+
+	key := strconv.FormatInt(int64(eKey.EnterpriseNo), 10) + "_" + strconv.FormatInt(int64(eKey.ElementID), 10)
+	if eKey.MultiTypeID != 0 {
+		// Specify that this value is not the default type for its multi-type field
+		key += "_" + strconv.FormatInt(int64(eKey.MultiTypeID), 10)
+	}
+	return key
+}
+
+// writeField writes val for eKey, applying symbolic rendering for known
+// semantic and enum-like fields when opts.Semantics and opts.NamedFields
+// are both enabled.
+func (m *Message) writeField(b *bytes.Buffer, eKey ElementKey, val interface{}, opts MarshalOptions) error {
+	if opts.Semantics && opts.NamedFields {
+		if s, ok := semanticValue(eKey, val); ok {
+			bytes, err := json.Marshal(s)
+			if err != nil {
+				return err
+			}
+			b.Write(bytes)
+			return nil
+		}
+	}
+	return m.writeValue(b, val)
+}
+
+// semanticValue renders val as a symbolic string for the handful of
+// well-known IANA elements and types that have one, e.g. protocolIdentifier
+// as "TCP", tcpControlBits as "SYN|ACK", or dateTimeMilliseconds as an
+// RFC3339 timestamp. It returns ok=false for anything else so the caller
+// falls back to the plain typed rendering.
+func semanticValue(eKey ElementKey, val interface{}) (string, bool) {
+	if eKey.EnterpriseNo != 0 {
+		return "", false
+	}
+
+	switch eKey.ElementID {
+	case 4: // protocolIdentifier
+		if p, ok := val.(uint8); ok {
+			if name, ok := protocolNames[p]; ok {
+				return name, true
+			}
+		}
+	case 6: // tcpControlBits
+		if bits, ok := toUint64(val); ok {
+			return tcpControlBitsString(bits), true
+		}
+	case 136: // flowEndReason
+		if r, ok := val.(uint8); ok {
+			if name, ok := flowEndReasonNames[r]; ok {
+				return name, true
+			}
+		}
+	}
+
+	if entry, ok := lookupInfoElement(ElementKey{ElementID: eKey.ElementID}); ok && entry.Type == DateTimeMilliseconds {
+		if ms, ok := toUint64(val); ok {
+			return time.Unix(0, int64(ms)*int64(time.Millisecond)).UTC().Format(time.RFC3339), true
+		}
+	}
+
+	return "", false
+}
+
+func toUint64(val interface{}) (uint64, bool) {
+	switch v := val.(type) {
+	case uint8:
+		return uint64(v), true
+	case uint16:
+		return uint64(v), true
+	case uint32:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	}
+	return 0, false
+}
+
+// protocolNames maps IANA assigned internet protocol numbers to their name.
+var protocolNames = map[uint8]string{
+	1:   "ICMP",
+	6:   "TCP",
+	17:  "UDP",
+	41:  "IPv6",
+	47:  "GRE",
+	50:  "ESP",
+	58:  "ICMPv6",
+	132: "SCTP",
+}
+
+// flowEndReasonNames maps RFC 5102 flowEndReason enum values to their name.
+var flowEndReasonNames = map[uint8]string{
+	1: "idle timeout",
+	2: "active timeout",
+	3: "end of flow",
+	4: "forced end",
+	5: "lack of resources",
+}
+
+// tcpControlBitsNames maps each RFC 5102 tcpControlBits flag to its name,
+// in bit order from the least significant bit.
+var tcpControlBitsNames = []string{"FIN", "SYN", "RST", "PSH", "ACK", "URG", "ECE", "CWR", "NS"}
+
+func tcpControlBitsString(bits uint64) string {
+	var set []string
+	for i, name := range tcpControlBitsNames {
+		if bits&(1<<uint(i)) != 0 {
+			set = append(set, name)
+		}
+	}
+	if len(set) == 0 {
+		return fmt.Sprintf("0x%x", bits)
+	}
+
+	s := set[0]
+	for _, name := range set[1:] {
+		s += "|" + name
+	}
+	return s
+}
+
 func (m *Message) encodeHeader(b *bytes.Buffer) {
 	b.WriteString("\"Header\":{\"Version\":")
 	b.WriteString(strconv.FormatInt(int64(m.Header.Version), 10))
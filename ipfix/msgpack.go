@@ -0,0 +1,222 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    msgpack.go
+//: details: MessagePack encoder for decoded IPFIX data sets
+//: author:  Mehrdad Arshad Rad
+//: date:    03/12/2017
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package ipfix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"strconv"
+)
+
+// MsgpackEncoder encodes a data set as a MessagePack map, keyed the same
+// way as JSONEncoder's numeric mode ("<enterpriseNo>_<elementID>").
+type MsgpackEncoder struct{}
+
+// Encode implements Encoder.
+func (e *MsgpackEncoder) Encode(m *Message, datasetIndex int) ([]byte, error) {
+	var b bytes.Buffer
+
+	dataSet, _ := runTransforms(m.Header.DomainID, m.DataSets[datasetIndex])
+	writeMsgpackMapHeader(&b, len(dataSet))
+
+	for eKey, fields := range dataSet {
+		key := strconv.FormatInt(int64(eKey.EnterpriseNo), 10) + "_" + strconv.FormatInt(int64(eKey.ElementID), 10)
+		if eKey.MultiTypeID != 0 {
+			key += "_" + strconv.FormatInt(int64(eKey.MultiTypeID), 10)
+		}
+		writeMsgpackString(&b, key)
+
+		if len(fields) == 1 {
+			if err := writeMsgpackValue(&b, fields[0].Value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		writeMsgpackArrayHeader(&b, len(fields))
+		for _, field := range fields {
+			if err := writeMsgpackValue(&b, field.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return b.Bytes(), nil
+}
+
+func writeMsgpackValue(b *bytes.Buffer, val interface{}) error {
+	switch v := val.(type) {
+	case uint8:
+		writeMsgpackUint(b, uint64(v))
+	case uint16:
+		writeMsgpackUint(b, uint64(v))
+	case uint32:
+		writeMsgpackUint(b, uint64(v))
+	case uint64:
+		writeMsgpackUint(b, v)
+	case int8:
+		writeMsgpackInt(b, int64(v))
+	case int16:
+		writeMsgpackInt(b, int64(v))
+	case int32:
+		writeMsgpackInt(b, int64(v))
+	case int64:
+		writeMsgpackInt(b, v)
+	case float32:
+		b.WriteByte(0xca)
+		var buf [4]byte
+		binary.BigEndian.PutUint32(buf[:], math.Float32bits(v))
+		b.Write(buf[:])
+	case float64:
+		b.WriteByte(0xcb)
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+		b.Write(buf[:])
+	case string:
+		writeMsgpackString(b, v)
+	case net.IP:
+		writeMsgpackString(b, v.String())
+	case net.HardwareAddr:
+		writeMsgpackString(b, v.String())
+	case []uint8:
+		writeMsgpackBin(b, v)
+	default:
+		return errUknownMarshalDataType
+	}
+
+	return nil
+}
+
+func writeMsgpackUint(b *bytes.Buffer, v uint64) {
+	switch {
+	case v <= 0x7f:
+		b.WriteByte(byte(v))
+	case v <= 0xff:
+		b.WriteByte(0xcc)
+		b.WriteByte(byte(v))
+	case v <= 0xffff:
+		b.WriteByte(0xcd)
+		var buf [2]byte
+		binary.BigEndian.PutUint16(buf[:], uint16(v))
+		b.Write(buf[:])
+	case v <= 0xffffffff:
+		b.WriteByte(0xce)
+		var buf [4]byte
+		binary.BigEndian.PutUint32(buf[:], uint32(v))
+		b.Write(buf[:])
+	default:
+		b.WriteByte(0xcf)
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], v)
+		b.Write(buf[:])
+	}
+}
+
+func writeMsgpackInt(b *bytes.Buffer, v int64) {
+	if v >= 0 {
+		writeMsgpackUint(b, uint64(v))
+		return
+	}
+	b.WriteByte(0xd3)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(v))
+	b.Write(buf[:])
+}
+
+func writeMsgpackString(b *bytes.Buffer, s string) {
+	n := len(s)
+	switch {
+	case n <= 31:
+		b.WriteByte(0xa0 | byte(n))
+	case n <= 0xff:
+		b.WriteByte(0xd9)
+		b.WriteByte(byte(n))
+	case n <= 0xffff:
+		b.WriteByte(0xda)
+		var buf [2]byte
+		binary.BigEndian.PutUint16(buf[:], uint16(n))
+		b.Write(buf[:])
+	default:
+		b.WriteByte(0xdb)
+		var buf [4]byte
+		binary.BigEndian.PutUint32(buf[:], uint32(n))
+		b.Write(buf[:])
+	}
+	b.WriteString(s)
+}
+
+func writeMsgpackBin(b *bytes.Buffer, v []byte) {
+	n := len(v)
+	switch {
+	case n <= 0xff:
+		b.WriteByte(0xc4)
+		b.WriteByte(byte(n))
+	case n <= 0xffff:
+		b.WriteByte(0xc5)
+		var buf [2]byte
+		binary.BigEndian.PutUint16(buf[:], uint16(n))
+		b.Write(buf[:])
+	default:
+		b.WriteByte(0xc6)
+		var buf [4]byte
+		binary.BigEndian.PutUint32(buf[:], uint32(n))
+		b.Write(buf[:])
+	}
+	b.Write(v)
+}
+
+func writeMsgpackMapHeader(b *bytes.Buffer, n int) {
+	switch {
+	case n <= 15:
+		b.WriteByte(0x80 | byte(n))
+	case n <= 0xffff:
+		b.WriteByte(0xde)
+		var buf [2]byte
+		binary.BigEndian.PutUint16(buf[:], uint16(n))
+		b.Write(buf[:])
+	default:
+		b.WriteByte(0xdf)
+		var buf [4]byte
+		binary.BigEndian.PutUint32(buf[:], uint32(n))
+		b.Write(buf[:])
+	}
+}
+
+func writeMsgpackArrayHeader(b *bytes.Buffer, n int) {
+	switch {
+	case n <= 15:
+		b.WriteByte(0x90 | byte(n))
+	case n <= 0xffff:
+		b.WriteByte(0xdc)
+		var buf [2]byte
+		binary.BigEndian.PutUint16(buf[:], uint16(n))
+		b.Write(buf[:])
+	default:
+		b.WriteByte(0xdd)
+		var buf [4]byte
+		binary.BigEndian.PutUint32(buf[:], uint32(n))
+		b.Write(buf[:])
+	}
+}
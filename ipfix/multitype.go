@@ -0,0 +1,176 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    multitype.go
+//: details: general registry for elements whose concrete type varies by observation domain
+//: author:  Mehrdad Arshad Rad
+//: date:    07/30/2017
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package ipfix
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"gopkg.in/yaml.v2"
+)
+
+// MultiTypeDiscriminator picks, from raw's content, which of an
+// element's declared candidate types it should decode as, returning its
+// index into that element's candidate list.
+type MultiTypeDiscriminator func(raw []byte, candidates []FieldType) int
+
+// multiTypeDiscriminators holds the discriminators available to
+// ipfix.multitypes by name, plus any Go-native ones added through
+// RegisterMultiTypeDiscriminator.
+var multiTypeDiscriminators = map[string]MultiTypeDiscriminator{
+	"length": lengthDiscriminator,
+}
+
+// RegisterMultiTypeDiscriminator adds or replaces the discriminator used
+// when an ipfix.multitypes entry names it, letting sites with a
+// discriminator that can't be expressed as "length" (e.g. a magic byte
+// or sub-TLV) plug one in without patching this package.
+func RegisterMultiTypeDiscriminator(name string, fn MultiTypeDiscriminator) {
+	multiTypeDiscriminators[name] = fn
+}
+
+// multiTypeSpec is one ipfix.multitypes entry as loaded from YAML.
+type multiTypeSpec struct {
+	Candidates    []string `yaml:"candidates"`
+	Discriminator string   `yaml:"discriminator"`
+}
+
+// multiTypeEntry is a multiTypeSpec resolved against FieldTypes and the
+// discriminator registry, ready to use at decode time.
+type multiTypeEntry struct {
+	candidates    []FieldType
+	discriminator MultiTypeDiscriminator
+}
+
+// multiTypes holds the loaded entries, keyed by the element's
+// EnterpriseNo/ElementID (MultiTypeID is always 0 in the key: it is an
+// output of resolution, not an input).
+var multiTypes = map[ElementKey]multiTypeEntry{}
+
+// LoadMultiTypes loads multi-type element declarations through the
+// ipfix.multitypes file, alongside ipfix.elements. A missing file is not
+// an error: ResolveMultiType then simply never matches.
+func LoadMultiTypes(cfgPath string) error {
+	file := path.Join(cfgPath, "ipfix.multitypes")
+
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var cfg map[uint32]map[uint16]multiTypeSpec
+	if err = yaml.Unmarshal(b, &cfg); err != nil {
+		return err
+	}
+
+	multiTypes = make(map[ElementKey]multiTypeEntry)
+
+	for pen, elements := range cfg {
+		for elementID, spec := range elements {
+			candidates := make([]FieldType, 0, len(spec.Candidates))
+			for _, name := range spec.Candidates {
+				candidates = append(candidates, FieldTypes[name])
+			}
+
+			discriminator := multiTypeDiscriminators["length"]
+			if spec.Discriminator != "" {
+				if fn, ok := multiTypeDiscriminators[spec.Discriminator]; ok {
+					discriminator = fn
+				}
+			}
+
+			multiTypes[ElementKey{EnterpriseNo: pen, ElementID: elementID}] = multiTypeEntry{
+				candidates:    candidates,
+				discriminator: discriminator,
+			}
+		}
+	}
+
+	return nil
+}
+
+// ResolveMultiType reports whether key was declared in ipfix.multitypes
+// and, if so, which candidate FieldType raw decodes as and the
+// MultiTypeID to tag it with in the element's ElementKey - generalizing
+// the old one-off Ipv4OrString/MultiTypeID handling to any element.
+func ResolveMultiType(key ElementKey, raw []byte) (fieldType FieldType, multiTypeID uint8, ok bool) {
+	entry, found := multiTypes[ElementKey{EnterpriseNo: key.EnterpriseNo, ElementID: key.ElementID}]
+	if !found || len(entry.candidates) == 0 {
+		return Unknown, 0, false
+	}
+
+	idx := entry.discriminator(raw, entry.candidates)
+	if idx < 0 || idx >= len(entry.candidates) {
+		idx = 0
+	}
+
+	return entry.candidates[idx], uint8(idx), true
+}
+
+// fixedLength returns the on-the-wire length of t when it is a
+// fixed-length type, and ok=false for variable-length types such as
+// String or OctetArray.
+func fixedLength(t FieldType) (int, bool) {
+	switch t {
+	case Uint8, Int8, Boolean:
+		return 1, true
+	case Uint16, Int16:
+		return 2, true
+	case Uint32, Int32, Float32, Ipv4Address, DateTimeSeconds:
+		return 4, true
+	case Uint64, Int64, Float64, DateTimeMilliseconds, DateTimeMicroseconds, DateTimeNanoseconds:
+		return 8, true
+	case MacAddress:
+		return 6, true
+	case Ipv6Address:
+		return 16, true
+	}
+	return 0, false
+}
+
+// lengthDiscriminator is the default MultiTypeDiscriminator: it picks
+// the first candidate whose fixed length matches len(raw), falling back
+// to the first variable-length candidate (e.g. string) otherwise. With
+// the candidate list [string, ipv4Address] this reproduces the original
+// Ipv4OrString behavior (IPv4 as MultiTypeID 1, string as the default
+// MultiTypeID 0) and generalizes it to any candidate list.
+func lengthDiscriminator(raw []byte, candidates []FieldType) int {
+	for i, t := range candidates {
+		if n, ok := fixedLength(t); ok && n == len(raw) {
+			return i
+		}
+	}
+
+	for i, t := range candidates {
+		if _, ok := fixedLength(t); !ok {
+			return i
+		}
+	}
+
+	return 0
+}
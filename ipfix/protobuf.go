@@ -0,0 +1,239 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    protobuf.go
+//: details: protobuf encoder and .proto schema generation for the loaded InfoModel
+//: author:  Mehrdad Arshad Rad
+//: date:    03/12/2017
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package ipfix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+)
+
+// protoElementIDSpan is one more than the largest value an ElementID
+// (uint16) can hold, i.e. the width of the field-number block reserved
+// per enterprise number below.
+const protoElementIDSpan = 1 << 16
+
+// penBlock returns pen's field-number block index: its 1-based position
+// among the distinct enterprise numbers currently present in InfoModel,
+// sorted ascending. This makes the block assignment a pure function of
+// InfoModel's PEN set rather than of encounter order, so the same PEN
+// always gets the same block regardless of process restarts, map
+// iteration order, or which vendor's traffic happens to arrive first -
+// the stability GenerateProtoSchema's .proto contract depends on. A PEN
+// not present in InfoModel (e.g. traffic for an element nobody loaded)
+// sorts after every known PEN rather than colliding with block 1.
+func penBlock(pen uint32) int {
+	snapshot := snapshotInfoModel()
+
+	seen := map[uint32]bool{}
+	pens := make([]uint32, 0, len(snapshot))
+	for k := range snapshot {
+		if k.EnterpriseNo != 0 && !seen[k.EnterpriseNo] {
+			seen[k.EnterpriseNo] = true
+			pens = append(pens, k.EnterpriseNo)
+		}
+	}
+	sort.Slice(pens, func(i, j int) bool { return pens[i] < pens[j] })
+
+	for i, p := range pens {
+		if p == pen {
+			return i + 1
+		}
+	}
+	return len(pens) + 1
+}
+
+// protoFieldNo derives a stable protobuf field number from an element
+// key. IANA (PEN 0) elements map 1:1 onto their element ID, which is
+// already guaranteed unique and small. Enterprise elements get their own
+// protoElementIDSpan-wide block above the IANA range, one per PEN present
+// in InfoModel, so two such vendors can never collide no matter how large
+// their element IDs run (e.g. Cisco NBAR/AVC IDs well into the tens of
+// thousands). Every PEN absent from InfoModel shares the single block
+// after the last known one (see penBlock).
+func protoFieldNo(k ElementKey) int {
+	if k.EnterpriseNo == 0 {
+		return int(k.ElementID)
+	}
+	return protoElementIDSpan*penBlock(k.EnterpriseNo) + int(k.ElementID)
+}
+
+// protoFieldName turns an InfoModel entry into a lowerCamelCase
+// protobuf field name, prefixing enterprise elements with their PEN so
+// names stay unique across vendors.
+func protoFieldName(k ElementKey, entry InfoElementEntry) string {
+	if k.EnterpriseNo == 0 {
+		return entry.Name
+	}
+	return fmt.Sprintf("pen%d_%s", k.EnterpriseNo, entry.Name)
+}
+
+// protoScalarType maps an IPFIX FieldType onto the closest protobuf
+// scalar type.
+func protoScalarType(t FieldType) string {
+	switch t {
+	case Uint8, Uint16, Uint32:
+		return "uint32"
+	case Uint64:
+		return "uint64"
+	case Int8, Int16, Int32:
+		return "int32"
+	case Int64:
+		return "int64"
+	case Float32:
+		return "float"
+	case Float64:
+		return "double"
+	case Boolean:
+		return "bool"
+	case Ipv4Address, Ipv6Address, MacAddress, OctetArray:
+		return "bytes"
+	case DateTimeSeconds, DateTimeMilliseconds, DateTimeMicroseconds, DateTimeNanoseconds:
+		return "uint64"
+	default:
+		return "string"
+	}
+}
+
+// GenerateProtoSchema walks the currently loaded InfoModel (IANA and
+// enterprise element definitions) and emits a .proto file describing a
+// single FlowRecord message, one field per known element. It is meant
+// to be regenerated whenever ipfix.elements changes so the schema used
+// by downstream consumers stays in sync with the decoder.
+func GenerateProtoSchema() string {
+	var b bytes.Buffer
+
+	b.WriteString("syntax = \"proto3\";\n\n")
+	b.WriteString("package ipfix;\n\n")
+	b.WriteString("message FlowRecord {\n")
+
+	snapshot := snapshotInfoModel()
+
+	keys := make([]ElementKey, 0, len(snapshot))
+	for k := range snapshot {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return protoFieldNo(keys[i]) < protoFieldNo(keys[j]) })
+
+	for _, k := range keys {
+		entry := snapshot[k]
+		name := strings.ToLower(protoFieldName(k, entry)[:1]) + protoFieldName(k, entry)[1:]
+		fmt.Fprintf(&b, "  %s %s = %d;\n", protoScalarType(entry.Type), name, protoFieldNo(k))
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// ProtobufEncoder encodes a data set as a proto3 message using the
+// standard tag-length-value wire format, with field numbers and types
+// derived from InfoModel (see GenerateProtoSchema).
+type ProtobufEncoder struct{}
+
+// Encode implements Encoder.
+func (e *ProtobufEncoder) Encode(m *Message, datasetIndex int) ([]byte, error) {
+	var b bytes.Buffer
+
+	dataSet, _ := runTransforms(m.Header.DomainID, m.DataSets[datasetIndex])
+	for eKey, fields := range dataSet {
+		for _, field := range fields {
+			if err := writeProtoField(&b, protoFieldNo(eKey), field.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return b.Bytes(), nil
+}
+
+func writeProtoField(b *bytes.Buffer, fieldNo int, val interface{}) error {
+	switch v := val.(type) {
+	case uint8:
+		writeProtoVarint(b, fieldNo, uint64(v))
+	case uint16:
+		writeProtoVarint(b, fieldNo, uint64(v))
+	case uint32:
+		writeProtoVarint(b, fieldNo, uint64(v))
+	case uint64:
+		writeProtoVarint(b, fieldNo, v)
+	case int8:
+		writeProtoVarint(b, fieldNo, uint64(v))
+	case int16:
+		writeProtoVarint(b, fieldNo, uint64(v))
+	case int32:
+		writeProtoVarint(b, fieldNo, uint64(v))
+	case int64:
+		writeProtoVarint(b, fieldNo, uint64(v))
+	case float32:
+		writeProtoTag(b, fieldNo, 5)
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], math.Float32bits(v))
+		b.Write(buf[:])
+	case float64:
+		writeProtoTag(b, fieldNo, 1)
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+		b.Write(buf[:])
+	case string:
+		writeProtoBytes(b, fieldNo, []byte(v))
+	case net.IP:
+		writeProtoBytes(b, fieldNo, []byte(v))
+	case net.HardwareAddr:
+		writeProtoBytes(b, fieldNo, []byte(v))
+	case []uint8:
+		writeProtoBytes(b, fieldNo, v)
+	default:
+		return errUknownMarshalDataType
+	}
+
+	return nil
+}
+
+// writeProtoTag writes a protobuf field tag (field number << 3 | wire type).
+func writeProtoTag(b *bytes.Buffer, fieldNo, wireType int) {
+	writeProtoUvarint(b, uint64(fieldNo)<<3|uint64(wireType))
+}
+
+func writeProtoVarint(b *bytes.Buffer, fieldNo int, v uint64) {
+	writeProtoTag(b, fieldNo, 0)
+	writeProtoUvarint(b, v)
+}
+
+func writeProtoBytes(b *bytes.Buffer, fieldNo int, v []byte) {
+	writeProtoTag(b, fieldNo, 2)
+	writeProtoUvarint(b, uint64(len(v)))
+	b.Write(v)
+}
+
+func writeProtoUvarint(b *bytes.Buffer, v uint64) {
+	for v >= 0x80 {
+		b.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	b.WriteByte(byte(v))
+}
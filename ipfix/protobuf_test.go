@@ -0,0 +1,104 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    protobuf_test.go
+//: details: protobuf field-number allocation tests
+//: author:  Mehrdad Arshad Rad
+//: date:    08/18/2017
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package ipfix
+
+import "testing"
+
+// TestProtoFieldNoNoCollision exercises the case that used to collide:
+// two enterprise vendors with element IDs well above 1000, like the
+// NBAR/AVC-style IDs Cisco and similar vendors assign.
+func TestProtoFieldNoNoCollision(t *testing.T) {
+	InfoModel = IANAInfoModel{
+		{EnterpriseNo: 9, ElementID: 12230}: InfoElementEntry{FieldID: 12230, Name: "ciscoAppID", Type: String},
+		{EnterpriseNo: 21, ElementID: 230}:  InfoElementEntry{FieldID: 230, Name: "otherVendorField", Type: Uint32},
+		{EnterpriseNo: 0, ElementID: 4}:     InfoElementEntry{FieldID: 4, Name: "protocolIdentifier", Type: Uint8},
+	}
+
+	seen := map[int]ElementKey{}
+	for k := range InfoModel {
+		no := protoFieldNo(k)
+		if other, collided := seen[no]; collided {
+			t.Fatalf("protoFieldNo collision: %+v and %+v both map to %d", k, other, no)
+		}
+		seen[no] = k
+	}
+}
+
+// TestGenerateProtoSchemaNoDuplicateFieldNumbers checks that the field
+// number GenerateProtoSchema assigns to each InfoModel element (its
+// protoFieldNo) is unique, which is what protoc itself enforces, and that
+// the rendered schema is non-empty.
+func TestGenerateProtoSchemaNoDuplicateFieldNumbers(t *testing.T) {
+	InfoModel = IANAInfoModel{
+		{EnterpriseNo: 9, ElementID: 12230}: InfoElementEntry{FieldID: 12230, Name: "ciscoAppID", Type: String},
+		{EnterpriseNo: 21, ElementID: 230}:  InfoElementEntry{FieldID: 230, Name: "otherVendorField", Type: Uint32},
+	}
+
+	seen := map[int]bool{}
+	for k := range InfoModel {
+		no := protoFieldNo(k)
+		if seen[no] {
+			t.Fatalf("duplicate field number %d in generated schema", no)
+		}
+		seen[no] = true
+	}
+
+	if GenerateProtoSchema() == "" {
+		t.Fatal("expected non-empty schema")
+	}
+}
+
+// TestProtoFieldNoDeterministicAcrossEncounterOrder guards against the
+// bug where a PEN's field-number block was assigned by whichever order
+// protoFieldNo happened to see enterprise numbers in: the same InfoModel
+// content must yield the same field number for a given element
+// regardless of which PEN protoFieldNo is asked about first.
+func TestProtoFieldNoDeterministicAcrossEncounterOrder(t *testing.T) {
+	cisco := ElementKey{EnterpriseNo: 9, ElementID: 12230}
+	paloAlto := ElementKey{EnterpriseNo: 25461, ElementID: 1}
+
+	InfoModel = IANAInfoModel{
+		cisco:    InfoElementEntry{FieldID: 12230, Name: "ciscoAppID", Type: String},
+		paloAlto: InfoElementEntry{FieldID: 1, Name: "panField", Type: Uint32},
+	}
+
+	// Ask about Palo Alto's PEN first.
+	paloAltoFirst := protoFieldNo(paloAlto)
+	ciscoSecond := protoFieldNo(cisco)
+
+	// Reload the identical InfoModel content and ask about Cisco's PEN
+	// first instead.
+	InfoModel = IANAInfoModel{
+		cisco:    InfoElementEntry{FieldID: 12230, Name: "ciscoAppID", Type: String},
+		paloAlto: InfoElementEntry{FieldID: 1, Name: "panField", Type: Uint32},
+	}
+	ciscoFirst := protoFieldNo(cisco)
+	paloAltoSecond := protoFieldNo(paloAlto)
+
+	if ciscoFirst != ciscoSecond {
+		t.Fatalf("cisco field number depends on encounter order: %d vs %d", ciscoFirst, ciscoSecond)
+	}
+	if paloAltoFirst != paloAltoSecond {
+		t.Fatalf("palo alto field number depends on encounter order: %d vs %d", paloAltoFirst, paloAltoSecond)
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"sync"
 
 	"gopkg.in/yaml.v2"
 )
@@ -132,7 +133,22 @@ const (
 
 	// Begin custom types
 	// Either an Ipv4Address (if 4 bytes, MultiTypeID 1) or a String (otherwise, MultiTypeID 0, default)
+	// Kept for back-compat; new multi-typed enterprise elements should be
+	// declared in ipfix.multitypes and resolved through ResolveMultiType
+	// instead of adding another one-off FieldType here.
 	Ipv4OrString
+
+	// BasicList represents a structured list of zero or more instances
+	// of an information element - RFC6313.
+	BasicList
+
+	// SubTemplateList represents a structured list of zero or more
+	// instances of a template - RFC6313.
+	SubTemplateList
+
+	// SubTemplateMultiList represents a structured list of zero or more
+	// instances of mixed templates - RFC6313.
+	SubTemplateMultiList
 )
 
 // FieldTypes represents data types
@@ -159,6 +175,10 @@ var FieldTypes = map[string]FieldType{
 	"ipv6Address":          Ipv6Address,
 	// Begin custom types
 	"ipv4OrString":         Ipv4OrString,
+	// RFC 6313 structured data types
+	"basicList":            BasicList,
+	"subTemplateList":      SubTemplateList,
+	"subTemplateMultiList": SubTemplateMultiList,
 }
 
 func (t FieldType) isVariableLength() bool {
@@ -166,7 +186,10 @@ func (t FieldType) isVariableLength() bool {
 		case
 			String,
 			OctetArray,
-			Ipv4OrString:
+			Ipv4OrString,
+			BasicList,
+			SubTemplateList,
+			SubTemplateMultiList:
 			return true
 	}
 	return false
@@ -175,6 +198,36 @@ func (t FieldType) isVariableLength() bool {
 //InfoModel maps element to name and type based on the field id and enterprise id
 var InfoModel IANAInfoModel;
 
+// infoModelMu guards InfoModel against concurrent access: it is read on
+// every encode (fieldKey, semanticValue, protoFieldNo) and written
+// whenever RFC 5610 self-describing elements are registered, and those
+// two things now happen concurrently across one goroutine per TCP/SCTP
+// session. Direct access to InfoModel outside this file should go
+// through lookupInfoElement/snapshotInfoModel rather than the map
+// itself.
+var infoModelMu sync.RWMutex
+
+// lookupInfoElement is the race-safe way to read a single InfoModel entry.
+func lookupInfoElement(key ElementKey) (InfoElementEntry, bool) {
+	infoModelMu.RLock()
+	defer infoModelMu.RUnlock()
+	entry, ok := InfoModel[key]
+	return entry, ok
+}
+
+// snapshotInfoModel returns a copy of InfoModel safe to range over
+// without holding infoModelMu for the duration.
+func snapshotInfoModel() IANAInfoModel {
+	infoModelMu.RLock()
+	defer infoModelMu.RUnlock()
+
+	snapshot := make(IANAInfoModel, len(InfoModel))
+	for k, v := range InfoModel {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
 // LoadExtElements loads ipfix elements information through ipfix.elemets file
 func LoadExtElements(cfgPath string) error {
 	var (
@@ -195,15 +248,19 @@ func LoadExtElements(cfgPath string) error {
 		return err
 	}
 
-	InfoModel = make(map[ElementKey]InfoElementEntry)
-
+	loaded := make(IANAInfoModel)
 	for PEN, elements := range ipfixElements {
 		for elementID, prop := range elements {
 			if len(prop) > 1 {
-				InfoModel[ElementKey{EnterpriseNo: PEN, ElementID: elementID}] =
+				loaded[ElementKey{EnterpriseNo: PEN, ElementID: elementID}] =
 					InfoElementEntry{FieldID: elementID, Name: prop[0], Type: FieldTypes[prop[1]]}
 			}
 		}
 	}
+
+	infoModelMu.Lock()
+	InfoModel = loaded
+	infoModelMu.Unlock()
+
 	return nil
 }
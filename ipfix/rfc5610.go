@@ -0,0 +1,174 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    rfc5610.go
+//: details: dynamic InfoModel registration from RFC 5610 self-describing options templates
+//: author:  Mehrdad Arshad Rad
+//: date:    05/20/2017
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package ipfix
+
+import "errors"
+
+// RFC 5610 carries its information element metadata as regular IPFIX
+// elements inside an options template record; these are their element
+// IDs from the IANA registry.
+const (
+	ieInformationElementID        uint16 = 303
+	ieInformationElementDataType  uint16 = 339
+	ieInformationElementName      uint16 = 341
+	ieInformationElementSemantics uint16 = 344
+	iePrivateEnterpriseNumber     uint16 = 346
+)
+
+// rfc5610AbstractTypes maps the RFC 5610 informationElementDataType enum
+// (identical to the IANA "IPFIX Information Element Data Types"
+// registry) onto the FieldType this package decodes data with.
+var rfc5610AbstractTypes = map[uint8]FieldType{
+	0:  OctetArray,
+	1:  Uint8,
+	2:  Uint16,
+	3:  Uint32,
+	4:  Uint64,
+	5:  Int8,
+	6:  Int16,
+	7:  Int32,
+	8:  Int64,
+	9:  Float32,
+	10: Float64,
+	11: Boolean,
+	12: MacAddress,
+	13: String,
+	14: DateTimeSeconds,
+	15: DateTimeMilliseconds,
+	16: DateTimeMicroseconds,
+	17: DateTimeNanoseconds,
+	18: Ipv4Address,
+	19: Ipv6Address,
+	20: BasicList,
+	21: SubTemplateList,
+	22: SubTemplateMultiList,
+}
+
+var errIncompleteSelfDescribingElement = errors.New("incomplete RFC 5610 information element record")
+
+// PreferSelfDescribing, when true, lets information elements learned
+// from RFC 5610 options records overwrite an existing static InfoModel
+// entry for the same ElementKey. The default (false) keeps ipfix.elements
+// authoritative and only fills in gaps it leaves.
+var PreferSelfDescribing = false
+
+// RegisterSelfDescribingElement reads one decoded RFC 5610 options
+// template record - informationElementId, privateEnterpriseNumber,
+// informationElementDataType and informationElementName, at minimum -
+// and adds it to InfoModel so subsequent data records carrying that
+// enterprise element decode with the right FieldType and name even
+// without a static ipfix.elements entry.
+func RegisterSelfDescribingElement(record DataSet) error {
+	elementID, ok := uint16Field(record, ieInformationElementID)
+	if !ok {
+		return errIncompleteSelfDescribingElement
+	}
+
+	enterpriseNo, ok := uint32Field(record, iePrivateEnterpriseNumber)
+	if !ok {
+		return errIncompleteSelfDescribingElement
+	}
+
+	dataType, ok := uint8Field(record, ieInformationElementDataType)
+	if !ok {
+		return errIncompleteSelfDescribingElement
+	}
+
+	name, ok := stringField(record, ieInformationElementName)
+	if !ok {
+		return errIncompleteSelfDescribingElement
+	}
+
+	fieldType, ok := rfc5610AbstractTypes[dataType]
+	if !ok {
+		fieldType = Unknown
+	}
+
+	key := ElementKey{EnterpriseNo: enterpriseNo, ElementID: elementID}
+
+	infoModelMu.Lock()
+	defer infoModelMu.Unlock()
+
+	if InfoModel == nil {
+		InfoModel = make(IANAInfoModel)
+	}
+
+	if _, exists := InfoModel[key]; exists && !PreferSelfDescribing {
+		return nil
+	}
+
+	InfoModel[key] = InfoElementEntry{FieldID: elementID, Name: name, Type: fieldType}
+
+	return nil
+}
+
+// informationElementSemantics, when present, describes how repeated
+// values of the element combine (RFC 5610 section 3.2); it is decoded
+// for completeness but does not currently influence marshaling.
+func informationElementSemantics(record DataSet) (uint8, bool) {
+	return uint8Field(record, ieInformationElementSemantics)
+}
+
+func uint8Field(ds DataSet, elementID uint16) (uint8, bool) {
+	v, ok := scalarField(ds, elementID)
+	if !ok {
+		return 0, false
+	}
+	u, ok := toUint64(v)
+	return uint8(u), ok
+}
+
+func uint16Field(ds DataSet, elementID uint16) (uint16, bool) {
+	v, ok := scalarField(ds, elementID)
+	if !ok {
+		return 0, false
+	}
+	u, ok := toUint64(v)
+	return uint16(u), ok
+}
+
+func uint32Field(ds DataSet, elementID uint16) (uint32, bool) {
+	v, ok := scalarField(ds, elementID)
+	if !ok {
+		return 0, false
+	}
+	u, ok := toUint64(v)
+	return uint32(u), ok
+}
+
+func stringField(ds DataSet, elementID uint16) (string, bool) {
+	v, ok := scalarField(ds, elementID)
+	if !ok {
+		return "", false
+	}
+	s, ok := v.(string)
+	return s, ok
+}
+
+func scalarField(ds DataSet, elementID uint16) (interface{}, bool) {
+	fields, ok := ds[ElementKey{EnterpriseNo: 0, ElementID: elementID}]
+	if !ok || len(fields) == 0 {
+		return nil, false
+	}
+	return fields[0].Value, true
+}
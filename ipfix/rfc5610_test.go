@@ -0,0 +1,105 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    rfc5610_test.go
+//: details: RFC 5610 self-describing element registration tests
+//: author:  Mehrdad Arshad Rad
+//: date:    08/25/2017
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package ipfix
+
+import "testing"
+
+func selfDescribingRecord(enterpriseNo uint32, elementID uint16, dataType uint8, name string) DataSet {
+	return DataSet{
+		{ElementID: ieInformationElementID}:       []Field{{Value: elementID}},
+		{ElementID: iePrivateEnterpriseNumber}:    []Field{{Value: enterpriseNo}},
+		{ElementID: ieInformationElementDataType}: []Field{{Value: dataType}},
+		{ElementID: ieInformationElementName}:     []Field{{Value: name}},
+	}
+}
+
+func TestRegisterSelfDescribingElementFillsGap(t *testing.T) {
+	InfoModel = IANAInfoModel{}
+	PreferSelfDescribing = false
+
+	key := ElementKey{EnterpriseNo: 9, ElementID: 12230}
+	record := selfDescribingRecord(9, 12230, 13, "ciscoAppName") // 13 = String
+
+	if err := RegisterSelfDescribingElement(record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entry, ok := lookupInfoElement(key)
+	if !ok {
+		t.Fatal("expected element to be registered")
+	}
+	if entry.Name != "ciscoAppName" || entry.Type != String {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+}
+
+func TestRegisterSelfDescribingElementDoesNotOverwriteStaticEntryByDefault(t *testing.T) {
+	key := ElementKey{EnterpriseNo: 9, ElementID: 12230}
+	InfoModel = IANAInfoModel{
+		key: {FieldID: 12230, Name: "staticName", Type: Uint32},
+	}
+	PreferSelfDescribing = false
+
+	record := selfDescribingRecord(9, 12230, 13, "selfDescribedName")
+	if err := RegisterSelfDescribingElement(record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entry, _ := lookupInfoElement(key)
+	if entry.Name != "staticName" {
+		t.Fatalf("expected static InfoModel entry to be authoritative, got %q", entry.Name)
+	}
+}
+
+func TestRegisterSelfDescribingElementOverwritesWhenPreferred(t *testing.T) {
+	key := ElementKey{EnterpriseNo: 9, ElementID: 12230}
+	InfoModel = IANAInfoModel{
+		key: {FieldID: 12230, Name: "staticName", Type: Uint32},
+	}
+	PreferSelfDescribing = true
+	defer func() { PreferSelfDescribing = false }()
+
+	record := selfDescribingRecord(9, 12230, 13, "selfDescribedName")
+	if err := RegisterSelfDescribingElement(record); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entry, _ := lookupInfoElement(key)
+	if entry.Name != "selfDescribedName" || entry.Type != String {
+		t.Fatalf("expected self-described entry to win, got %+v", entry)
+	}
+}
+
+func TestRegisterSelfDescribingElementIncompleteRecord(t *testing.T) {
+	InfoModel = IANAInfoModel{}
+	PreferSelfDescribing = false
+
+	record := DataSet{
+		{ElementID: ieInformationElementID}: []Field{{Value: uint16(12230)}},
+		// missing privateEnterpriseNumber, dataType, name
+	}
+
+	if err := RegisterSelfDescribingElement(record); err != errIncompleteSelfDescribingElement {
+		t.Fatalf("expected errIncompleteSelfDescribingElement, got %v", err)
+	}
+}
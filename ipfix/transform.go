@@ -0,0 +1,252 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    transform.go
+//: details: declarative post-decode transform pipeline for IPFIX data sets
+//: author:  Mehrdad Arshad Rad
+//: date:    04/02/2017
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package ipfix
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TransformFunc implements a site-specific, Go-native rule action. It
+// receives the matching data set, the rule that fired, and arg - the
+// part of rule.Then.Derive after the first colon, e.g. "176,177" for
+// derive: "icmpTypeCodeIPv4:176,177" - so a transform can be
+// parameterized from YAML without baking values into Go code.
+type TransformFunc func(ds DataSet, rule TransformRule, arg string)
+
+// derivations holds the TransformFunc registered for each "derive" name.
+var derivations = map[string]TransformFunc{}
+
+// RegisterTransform adds a Go-native rule action under name so it can be
+// referenced from a "derive" rule in ipfix.transforms.
+func RegisterTransform(name string, fn TransformFunc) {
+	derivations[name] = fn
+}
+
+// When is the match condition of a TransformRule. A rule matches when
+// the element identified by EnterpriseNo/ElementID is present and its
+// first value, an unsigned integer compared as an int64, equals Equals.
+// Values of any other type (signed integers included) never match.
+type When struct {
+	EnterpriseNo uint32 `yaml:"enterpriseNo"`
+	ElementID    uint16 `yaml:"elementID"`
+	Equals       int64  `yaml:"equals"`
+}
+
+// Then is the action a TransformRule applies to the elements it names.
+// Only one of these is normally set per rule.
+type Then struct {
+	// Keep lists elements that should survive only while When matches;
+	// they are dropped otherwise. This is the declarative replacement
+	// for the old inline icmptype/icmpcode hack.
+	Keep []uint16 `yaml:"keep"`
+
+	// Drop lists elements to delete outright when When matches.
+	Drop []uint16 `yaml:"drop"`
+
+	// Rename maps an element ID to the name it should use in NamedFields
+	// output, overriding whatever InfoModel has on file for it.
+	Rename map[uint16]string `yaml:"rename"`
+
+	// Mask lists elements whose value should be coarsened rather than
+	// dropped: IPs are truncated to their /24 (v4) or /48 (v6) network,
+	// everything else becomes the literal string "masked".
+	Mask []uint16 `yaml:"mask"`
+
+	// Hash lists elements whose value should be replaced by the hex
+	// SHA-256 digest of its string form, to allow joins without
+	// exposing the raw value.
+	Hash []uint16 `yaml:"hash"`
+
+	// Derive names a TransformFunc registered via RegisterTransform that
+	// computes one or more elements from the rest of the data set, e.g.
+	// "icmpTypeCodeIPv4:176,177". Everything before the first colon is
+	// looked up in the registry; everything after it (if any) is passed
+	// to the transform verbatim as its arg.
+	Derive string `yaml:"derive"`
+}
+
+// TransformRule is one declarative post-decode rule loaded from
+// ipfix.transforms.
+type TransformRule struct {
+	When When `yaml:"when"`
+	Then Then `yaml:"then"`
+}
+
+// transformRules holds the loaded rules, keyed by observation domain ID.
+// Rules under the zero key apply to every domain that has no rules of
+// its own.
+var transformRules = map[uint32][]TransformRule{}
+
+// LoadTransforms loads per-observation-domain transform rules through
+// the ipfix.transforms file, alongside ipfix.elements. A missing file is
+// not an error: the transform pipeline then runs as a no-op.
+func LoadTransforms(cfgPath string) error {
+	file := path.Join(cfgPath, "ipfix.transforms")
+
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var cfg map[uint32][]TransformRule
+	if err = yaml.Unmarshal(b, &cfg); err != nil {
+		return err
+	}
+
+	transformRules = cfg
+	return nil
+}
+
+// runTransforms applies the rules configured for domainID (falling back
+// to the global, zero-keyed rules) to ds and returns it alongside any
+// "rename" overrides those rules produced. ds is mutated in place; the
+// returned DataSet is purely for call-site convenience. The rename
+// overrides are scoped to this single call - they are not written back
+// into InfoModel, since transformRules are per-observation-domain and a
+// rename configured for one domain must not leak into another's output
+// or race with concurrent encodes on a shared package-level map.
+func runTransforms(domainID uint32, ds DataSet) (DataSet, map[ElementKey]string) {
+	rules, ok := transformRules[domainID]
+	if !ok {
+		rules = transformRules[0]
+	}
+
+	var overrides map[ElementKey]string
+	for _, rule := range rules {
+		applyRule(ds, rule, &overrides)
+	}
+
+	return ds, overrides
+}
+
+// applyRule applies rule to ds. Any "rename" actions are recorded into
+// *overrides (allocating it on first use) rather than InfoModel.
+func applyRule(ds DataSet, rule TransformRule, overrides *map[ElementKey]string) {
+	matched := whenMatches(ds, rule.When)
+
+	if len(rule.Then.Keep) > 0 && !matched {
+		for _, id := range rule.Then.Keep {
+			delete(ds, ElementKey{EnterpriseNo: rule.When.EnterpriseNo, ElementID: id})
+		}
+	}
+
+	if !matched {
+		return
+	}
+
+	for _, id := range rule.Then.Drop {
+		delete(ds, ElementKey{EnterpriseNo: rule.When.EnterpriseNo, ElementID: id})
+	}
+
+	for id, name := range rule.Then.Rename {
+		if *overrides == nil {
+			*overrides = make(map[ElementKey]string)
+		}
+		(*overrides)[ElementKey{EnterpriseNo: rule.When.EnterpriseNo, ElementID: id}] = name
+	}
+
+	for _, id := range rule.Then.Mask {
+		maskField(ds, ElementKey{EnterpriseNo: rule.When.EnterpriseNo, ElementID: id})
+	}
+
+	for _, id := range rule.Then.Hash {
+		hashField(ds, ElementKey{EnterpriseNo: rule.When.EnterpriseNo, ElementID: id})
+	}
+
+	if rule.Then.Derive != "" {
+		name, arg := splitDerive(rule.Then.Derive)
+		if fn, ok := derivations[name]; ok {
+			fn(ds, rule, arg)
+		}
+	}
+}
+
+// splitDerive splits a Then.Derive value into the registered transform
+// name and its argument, e.g. "icmpTypeCodeIPv4:176,177" becomes
+// ("icmpTypeCodeIPv4", "176,177"). A value with no colon is the name
+// with an empty argument.
+func splitDerive(s string) (name, arg string) {
+	if idx := strings.IndexByte(s, ':'); idx >= 0 {
+		return s[:idx], s[idx+1:]
+	}
+	return s, ""
+}
+
+func whenMatches(ds DataSet, w When) bool {
+	fields, ok := ds[ElementKey{EnterpriseNo: w.EnterpriseNo, ElementID: w.ElementID}]
+	if !ok || len(fields) == 0 {
+		return false
+	}
+
+	v, ok := toUint64(fields[0].Value)
+	if !ok {
+		return false
+	}
+
+	return int64(v) == w.Equals
+}
+
+func maskField(ds DataSet, key ElementKey) {
+	fields, ok := ds[key]
+	if !ok {
+		return
+	}
+
+	for i, field := range fields {
+		switch ip := field.Value.(type) {
+		case net.IP:
+			if v4 := ip.To4(); v4 != nil {
+				fields[i].Value = v4.Mask(net.CIDRMask(24, 32))
+			} else {
+				fields[i].Value = ip.Mask(net.CIDRMask(48, 128))
+			}
+		default:
+			fields[i].Value = "masked"
+		}
+	}
+}
+
+func hashField(ds DataSet, key ElementKey) {
+	fields, ok := ds[key]
+	if !ok {
+		return
+	}
+
+	for i, field := range fields {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%v", field.Value)))
+		fields[i].Value = hex.EncodeToString(sum[:])
+	}
+}
@@ -0,0 +1,161 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    transform_test.go
+//: details: declarative transform pipeline tests
+//: author:  Mehrdad Arshad Rad
+//: date:    08/25/2017
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package ipfix
+
+import (
+	"net"
+	"testing"
+)
+
+func TestApplyRuleDrop(t *testing.T) {
+	protoKey := ElementKey{ElementID: 4}
+	icmpTypeKey := ElementKey{ElementID: 176}
+
+	ds := DataSet{
+		protoKey:    []Field{{Value: uint8(1)}},
+		icmpTypeKey: []Field{{Value: uint8(8)}},
+	}
+
+	rule := TransformRule{
+		When: When{ElementID: 4, Equals: 1},
+		Then: Then{Drop: []uint16{176}},
+	}
+
+	var overrides map[ElementKey]string
+	applyRule(ds, rule, &overrides)
+
+	if _, ok := ds[icmpTypeKey]; ok {
+		t.Fatal("expected dropped field to be removed from the data set")
+	}
+	if _, ok := ds[protoKey]; !ok {
+		t.Fatal("expected unrelated field to survive")
+	}
+}
+
+func TestApplyRuleKeepOnlyWhenMatched(t *testing.T) {
+	protoKey := ElementKey{ElementID: 4}
+	icmpTypeKey := ElementKey{ElementID: 176}
+
+	ds := DataSet{
+		protoKey:    []Field{{Value: uint8(17)}}, // UDP, not ICMP
+		icmpTypeKey: []Field{{Value: uint8(8)}},
+	}
+
+	rule := TransformRule{
+		When: When{ElementID: 4, Equals: 1}, // matches ICMP only
+		Then: Then{Keep: []uint16{176}},
+	}
+
+	var overrides map[ElementKey]string
+	applyRule(ds, rule, &overrides)
+
+	if _, ok := ds[icmpTypeKey]; ok {
+		t.Fatal("expected icmpType to be dropped when the rule's When doesn't match")
+	}
+}
+
+func TestApplyRuleRenameProducesLocalOverrideNotInfoModelMutation(t *testing.T) {
+	InfoModel = IANAInfoModel{
+		{ElementID: 4}: {FieldID: 4, Name: "protocolIdentifier", Type: Uint8},
+	}
+
+	ds := DataSet{
+		{ElementID: 4}: []Field{{Value: uint8(1)}},
+	}
+
+	rule := TransformRule{
+		When: When{ElementID: 4, Equals: 1},
+		Then: Then{Rename: map[uint16]string{4: "proto"}},
+	}
+
+	var overrides map[ElementKey]string
+	applyRule(ds, rule, &overrides)
+
+	if overrides[ElementKey{ElementID: 4}] != "proto" {
+		t.Fatalf("expected rename override for element 4, got %v", overrides)
+	}
+	if entry, _ := lookupInfoElement(ElementKey{ElementID: 4}); entry.Name != "protocolIdentifier" {
+		t.Fatalf("rename must not mutate the shared InfoModel entry, got %q", entry.Name)
+	}
+}
+
+func TestApplyRuleMask(t *testing.T) {
+	protoKey := ElementKey{ElementID: 4}
+	srcIPKey := ElementKey{ElementID: 8} // sourceIPv4Address
+
+	ds := DataSet{
+		protoKey: []Field{{Value: uint8(1)}},
+		srcIPKey: []Field{{Value: net.ParseIP("203.0.113.42").To4()}},
+	}
+
+	rule := TransformRule{
+		When: When{ElementID: 4, Equals: 1},
+		Then: Then{Mask: []uint16{8}},
+	}
+
+	var overrides map[ElementKey]string
+	applyRule(ds, rule, &overrides)
+
+	masked, ok := ds[srcIPKey][0].Value.(net.IP)
+	if !ok {
+		t.Fatalf("expected masked value to remain a net.IP, got %T", ds[srcIPKey][0].Value)
+	}
+	if masked.String() != "203.0.113.0" {
+		t.Fatalf("expected /24 masked IPv4 address, got %s", masked.String())
+	}
+}
+
+func TestApplyRuleHash(t *testing.T) {
+	protoKey := ElementKey{ElementID: 4}
+	dstIPKey := ElementKey{ElementID: 12} // destinationIPv4Address
+
+	ds := DataSet{
+		protoKey: []Field{{Value: uint8(1)}},
+		dstIPKey: []Field{{Value: "10.0.0.1"}},
+	}
+
+	rule := TransformRule{
+		When: When{ElementID: 4, Equals: 1},
+		Then: Then{Hash: []uint16{12}},
+	}
+
+	var overrides map[ElementKey]string
+	applyRule(ds, rule, &overrides)
+
+	hashed, ok := ds[dstIPKey][0].Value.(string)
+	if !ok || hashed == "10.0.0.1" || len(hashed) != 64 {
+		t.Fatalf("expected a 64-char hex sha256 digest, got %v", ds[dstIPKey][0].Value)
+	}
+}
+
+func TestSplitDerive(t *testing.T) {
+	name, arg := splitDerive("icmpTypeCodeIPv4:176,177")
+	if name != "icmpTypeCodeIPv4" || arg != "176,177" {
+		t.Fatalf("unexpected split: name=%q arg=%q", name, arg)
+	}
+
+	name, arg = splitDerive("noArgTransform")
+	if name != "noArgTransform" || arg != "" {
+		t.Fatalf("unexpected split for no-colon derive: name=%q arg=%q", name, arg)
+	}
+}
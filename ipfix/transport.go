@@ -0,0 +1,500 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    transport.go
+//: details: IPFIX collector transports - RFC7011 section 10
+//: author:  Mehrdad Arshad Rad
+//: date:    06/14/2017
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package ipfix
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+
+	"github.com/pion/dtls/v2"
+	"github.com/ishidawataru/sctp"
+)
+
+// PacketHandler processes one fully reassembled IPFIX message read off
+// a Transport. agentID is the identity the message should be marshaled
+// with: the certificate CN for mutually authenticated transports, or
+// the peer's source address otherwise. cachedTemplate is the raw bytes
+// of the most recent whole message, whose first Set is a Template or
+// Options Template Set, that this session has seen for the message's
+// observation domain (nil if none yet, and
+// always nil on UDPTransport, which has no session to cache against),
+// letting a decoder reuse it for data sets that don't carry their own.
+type PacketHandler func(raw []byte, agentID string, cachedTemplate []byte) error
+
+// Transport listens for IPFIX export traffic on some underlying network
+// and hands each reassembled message to a PacketHandler, independent of
+// how the bytes were decoded into a Message. UDPTransport, TCPTLSTransport
+// and SCTPTransport all satisfy it.
+type Transport interface {
+	// ListenAndServe blocks, invoking handle for every message received,
+	// until Close is called or a fatal listener error occurs.
+	ListenAndServe(handle PacketHandler) error
+
+	// Close tears down the listener and any open sessions.
+	Close() error
+}
+
+var errShortIPFIXHeader = errors.New("ipfix: short message header")
+
+// messageLength reads the 16-bit Length field of the IPFIX message
+// header (RFC7011 section 3.1, bytes 2-3) so a stream transport knows
+// how many bytes make up the next message.
+func messageLength(header []byte) (uint16, error) {
+	if len(header) < 4 {
+		return 0, errShortIPFIXHeader
+	}
+	return binary.BigEndian.Uint16(header[2:4]), nil
+}
+
+// ipfixMessageHeaderLen is the size of the fixed IPFIX Message Header:
+// Version(2) + Length(2) + Export Time(4) + Sequence Number(4) +
+// Observation Domain ID(4) - RFC7011 section 3.1.
+const ipfixMessageHeaderLen = 16
+
+// domainID reads the Observation Domain ID out of a complete IPFIX
+// message so a stream transport can key its per-session template cache
+// without waiting on the full decoder.
+func domainID(msg []byte) (uint32, bool) {
+	if len(msg) < ipfixMessageHeaderLen {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(msg[12:ipfixMessageHeaderLen]), true
+}
+
+// firstSetID reads the Set ID of the first Set in msg, right after the
+// Message Header - RFC7011 section 3.3.
+func firstSetID(msg []byte) (uint16, bool) {
+	if len(msg) < ipfixMessageHeaderLen+4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(msg[ipfixMessageHeaderLen : ipfixMessageHeaderLen+2]), true
+}
+
+// isTemplateSetID reports whether setID identifies a Template Set (2) or
+// Options Template Set (3) rather than a Data Set (256+) - RFC7011
+// section 3.3.2/3.3.3.
+func isTemplateSetID(setID uint16) bool {
+	return setID == 2 || setID == 3
+}
+
+// sessionKey identifies a transport session for template caching
+// purposes: templates are scoped per exporting peer and observation
+// domain (RFC7011 section 8).
+type sessionKey struct {
+	peer     string
+	domainID uint32
+}
+
+// sessionTemplateCache caches the raw bytes of the most recent message
+// whose first Set is a Template/Options Template Set, per (peer,
+// DomainID), for session-oriented
+// transports, so a TCP/SCTP connection does not need to rely on UDP's
+// "resend on a timer" template refresh behavior: a data set that doesn't
+// carry its own template can be decoded against the session's last one.
+type sessionTemplateCache struct {
+	mu        sync.RWMutex
+	templates map[sessionKey][]byte
+}
+
+func newSessionTemplateCache() *sessionTemplateCache {
+	return &sessionTemplateCache{templates: make(map[sessionKey][]byte)}
+}
+
+func (c *sessionTemplateCache) get(peer string, domainID uint32) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	t, ok := c.templates[sessionKey{peer: peer, domainID: domainID}]
+	return t, ok
+}
+
+func (c *sessionTemplateCache) put(peer string, domainID uint32, template []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.templates[sessionKey{peer: peer, domainID: domainID}] = template
+}
+
+// observe inspects msg and, if its first Set is a Template or Options
+// Template Set, records the whole message in the cache for peer/the
+// message's own DomainID; template sets after the first Set are not
+// looked at. It
+// always returns the template currently cached for that (peer, DomainID)
+// pair - the one it just recorded, a previous one, or none - so callers
+// can hand it to the PacketHandler in the same step.
+func (c *sessionTemplateCache) observe(peer string, msg []byte) []byte {
+	domain, ok := domainID(msg)
+	if !ok {
+		return nil
+	}
+
+	if setID, ok := firstSetID(msg); ok && isTemplateSetID(setID) {
+		c.put(peer, domain, msg)
+	}
+
+	cached, _ := c.get(peer, domain)
+	return cached
+}
+
+// dropPeer forgets every template cached for peer, called once its
+// session tears down so a reconnect starts from a clean template state.
+func (c *sessionTemplateCache) dropPeer(peer string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.templates {
+		if k.peer == peer {
+			delete(c.templates, k)
+		}
+	}
+}
+
+// UDPTransport is the original, connectionless IPFIX collector: each
+// datagram is one complete message and AgentID is always the source IP.
+type UDPTransport struct {
+	Addr string
+
+	conn *net.UDPConn
+	stop chan struct{}
+}
+
+// NewUDPTransport returns a Transport that listens for IPFIX export
+// packets over UDP on addr (host:port).
+func NewUDPTransport(addr string) *UDPTransport {
+	return &UDPTransport{Addr: addr, stop: make(chan struct{})}
+}
+
+// ListenAndServe implements Transport.
+func (t *UDPTransport) ListenAndServe(handle PacketHandler) error {
+	laddr, err := net.ResolveUDPAddr("udp", t.Addr)
+	if err != nil {
+		return err
+	}
+
+	t.conn, err = net.ListenUDP("udp", laddr)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 65535)
+	for {
+		select {
+		case <-t.stop:
+			return nil
+		default:
+		}
+
+		n, raddr, err := t.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-t.stop:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		msg := make([]byte, n)
+		copy(msg, buf[:n])
+
+		if err := handle(msg, raddr.IP.String(), nil); err != nil {
+			return err
+		}
+	}
+}
+
+// Close implements Transport.
+func (t *UDPTransport) Close() error {
+	close(t.stop)
+	if t.conn == nil {
+		return nil
+	}
+	return t.conn.Close()
+}
+
+// TCPTLSConfig configures the mutual-TLS collector.
+type TCPTLSConfig struct {
+	Addr     string
+	CertFile string
+	KeyFile  string
+
+	// CABundle, when set, enables mutual authentication: client
+	// certificates are verified against it and their CN becomes the
+	// AgentID instead of the peer's source address.
+	CABundle string
+}
+
+// TCPTLSTransport is a session-oriented IPFIX collector over TCP+TLS, as
+// allowed by RFC7011 section 10.4. Each connection's byte stream is
+// reassembled into messages using the IPFIX header's Length field, and
+// templates are cached per (peer, DomainID) for the life of the session.
+type TCPTLSTransport struct {
+	cfg      TCPTLSConfig
+	listener net.Listener
+	cache    *sessionTemplateCache
+	stop     chan struct{}
+}
+
+// NewTCPTLSTransport returns a Transport that listens for IPFIX export
+// connections over TLS according to cfg.
+func NewTCPTLSTransport(cfg TCPTLSConfig) *TCPTLSTransport {
+	return &TCPTLSTransport{cfg: cfg, cache: newSessionTemplateCache(), stop: make(chan struct{})}
+}
+
+// Templates returns the per-session template cache this transport keeps
+// up to date as it observes Template/Options Template Sets on the wire
+// (see sessionTemplateCache.observe), for a decoder that wants to look
+// one up directly rather than through the cachedTemplate PacketHandler
+// argument.
+func (t *TCPTLSTransport) Templates() *sessionTemplateCache {
+	return t.cache
+}
+
+func (t *TCPTLSTransport) tlsConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(t.cfg.CertFile, t.cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if t.cfg.CABundle != "" {
+		pem, err := ioutil.ReadFile(t.cfg.CABundle)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("ipfix: no certificates found in CA bundle")
+		}
+
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsCfg, nil
+}
+
+// ListenAndServe implements Transport.
+func (t *TCPTLSTransport) ListenAndServe(handle PacketHandler) error {
+	tlsCfg, err := t.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	t.listener, err = tls.Listen("tcp", t.cfg.Addr, tlsCfg)
+	if err != nil {
+		return err
+	}
+
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			select {
+			case <-t.stop:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		go t.serveConn(conn, handle)
+	}
+}
+
+func (t *TCPTLSTransport) serveConn(conn net.Conn, handle PacketHandler) {
+	peer := conn.RemoteAddr().String()
+	agentID := peer
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err == nil {
+			certs := tlsConn.ConnectionState().PeerCertificates
+			if len(certs) > 0 && certs[0].Subject.CommonName != "" {
+				agentID = certs[0].Subject.CommonName
+			}
+		}
+	}
+
+	defer func() {
+		conn.Close()
+		t.cache.dropPeer(peer)
+	}()
+
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+
+		length, err := messageLength(header)
+		if err != nil || length < ipfixMessageHeaderLen {
+			return
+		}
+
+		msg := make([]byte, length)
+		copy(msg, header)
+		if _, err := io.ReadFull(conn, msg[4:]); err != nil {
+			return
+		}
+
+		cachedTemplate := t.cache.observe(peer, msg)
+		if err := handle(msg, agentID, cachedTemplate); err != nil {
+			return
+		}
+	}
+}
+
+// Close implements Transport.
+func (t *TCPTLSTransport) Close() error {
+	close(t.stop)
+	if t.listener == nil {
+		return nil
+	}
+	return t.listener.Close()
+}
+
+// SCTPConfig configures the SCTP+DTLS collector.
+type SCTPConfig struct {
+	Addr string
+
+	// DTLS, when set, wraps every SCTP association in a DTLS handshake
+	// using the same mutual-auth semantics as TCPTLSConfig.
+	DTLS *dtls.Config
+}
+
+// SCTPTransport is a session-oriented IPFIX collector over SCTP,
+// optionally secured with DTLS, as allowed by RFC7011 section 10.5/10.6.
+// Multi-streaming is left to the SCTP layer; message framing and
+// per-session template caching work exactly like TCPTLSTransport.
+type SCTPTransport struct {
+	cfg      SCTPConfig
+	listener *sctp.SCTPListener
+	cache    *sessionTemplateCache
+	stop     chan struct{}
+}
+
+// NewSCTPTransport returns a Transport that listens for IPFIX export
+// associations over SCTP according to cfg.
+func NewSCTPTransport(cfg SCTPConfig) *SCTPTransport {
+	return &SCTPTransport{cfg: cfg, cache: newSessionTemplateCache(), stop: make(chan struct{})}
+}
+
+// Templates returns the per-session template cache this transport keeps
+// up to date as it observes Template/Options Template Sets on the wire
+// (see sessionTemplateCache.observe), for a decoder that wants to look
+// one up directly rather than through the cachedTemplate PacketHandler
+// argument.
+func (t *SCTPTransport) Templates() *sessionTemplateCache {
+	return t.cache
+}
+
+// ListenAndServe implements Transport.
+func (t *SCTPTransport) ListenAndServe(handle PacketHandler) error {
+	laddr, err := sctp.ResolveSCTPAddr("sctp", t.cfg.Addr)
+	if err != nil {
+		return err
+	}
+
+	t.listener, err = sctp.ListenSCTP("sctp", laddr)
+	if err != nil {
+		return err
+	}
+
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			select {
+			case <-t.stop:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		var stream net.Conn = conn
+		if t.cfg.DTLS != nil {
+			stream, err = dtls.Server(conn, t.cfg.DTLS)
+			if err != nil {
+				conn.Close()
+				continue
+			}
+		}
+
+		go t.serveStream(stream, handle)
+	}
+}
+
+func (t *SCTPTransport) serveStream(conn net.Conn, handle PacketHandler) {
+	peer := conn.RemoteAddr().String()
+	agentID := peer
+
+	if dtlsConn, ok := conn.(*dtls.Conn); ok {
+		certs := dtlsConn.ConnectionState().PeerCertificates
+		if len(certs) > 0 {
+			if cert, err := x509.ParseCertificate(certs[0]); err == nil && cert.Subject.CommonName != "" {
+				agentID = cert.Subject.CommonName
+			}
+		}
+	}
+
+	defer func() {
+		conn.Close()
+		t.cache.dropPeer(peer)
+	}()
+
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+
+		length, err := messageLength(header)
+		if err != nil || length < ipfixMessageHeaderLen {
+			return
+		}
+
+		msg := make([]byte, length)
+		copy(msg, header)
+		if _, err := io.ReadFull(conn, msg[4:]); err != nil {
+			return
+		}
+
+		cachedTemplate := t.cache.observe(peer, msg)
+		if err := handle(msg, agentID, cachedTemplate); err != nil {
+			return
+		}
+	}
+}
+
+// Close implements Transport.
+func (t *SCTPTransport) Close() error {
+	close(t.stop)
+	if t.listener == nil {
+		return nil
+	}
+	return t.listener.Close()
+}
@@ -0,0 +1,74 @@
+//: ----------------------------------------------------------------------------
+//: Copyright (C) 2017 Verizon.  All Rights Reserved.
+//: All Rights Reserved
+//:
+//: file:    transport_test.go
+//: details: session template cache tests
+//: author:  Mehrdad Arshad Rad
+//: date:    08/18/2017
+//:
+//: Licensed under the Apache License, Version 2.0 (the "License");
+//: you may not use this file except in compliance with the License.
+//: You may obtain a copy of the License at
+//:
+//:     http://www.apache.org/licenses/LICENSE-2.0
+//:
+//: Unless required by applicable law or agreed to in writing, software
+//: distributed under the License is distributed on an "AS IS" BASIS,
+//: WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//: See the License for the specific language governing permissions and
+//: limitations under the License.
+//: ----------------------------------------------------------------------------
+
+package ipfix
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// ipfixMsg builds a minimal, well-formed IPFIX message with one Set for
+// test purposes: a 16-byte Message Header followed by a 4-byte Set
+// Header (Set ID, Length).
+func ipfixMsg(domain uint32, setID uint16, body []byte) []byte {
+	length := ipfixMessageHeaderLen + 4 + len(body)
+	msg := make([]byte, length)
+
+	binary.BigEndian.PutUint16(msg[0:2], 10) // Version
+	binary.BigEndian.PutUint16(msg[2:4], uint16(length))
+	binary.BigEndian.PutUint32(msg[12:16], domain)
+
+	binary.BigEndian.PutUint16(msg[16:18], setID)
+	binary.BigEndian.PutUint16(msg[18:20], uint16(4+len(body)))
+	copy(msg[20:], body)
+
+	return msg
+}
+
+func TestSessionTemplateCacheObserve(t *testing.T) {
+	c := newSessionTemplateCache()
+	peer := "10.0.0.1:12345"
+
+	if got := c.observe(peer, ipfixMsg(7, 256, []byte{0xaa})); got != nil {
+		t.Fatalf("expected no cached template before one is seen, got %v", got)
+	}
+
+	tmpl := ipfixMsg(7, 2, []byte{0x01, 0x02})
+	if got := c.observe(peer, tmpl); string(got) != string(tmpl) {
+		t.Fatalf("expected the just-observed template set to be cached and returned")
+	}
+
+	data := ipfixMsg(7, 256, []byte{0xbb})
+	if got := c.observe(peer, data); string(got) != string(tmpl) {
+		t.Fatalf("expected the previously cached template to still apply to a later data set")
+	}
+
+	if got := c.observe(peer, ipfixMsg(9, 256, []byte{0xcc})); got != nil {
+		t.Fatalf("expected domain 9 to have no cached template, got %v", got)
+	}
+
+	c.dropPeer(peer)
+	if got, ok := c.get(peer, 7); ok {
+		t.Fatalf("expected dropPeer to clear cached templates, got %v", got)
+	}
+}